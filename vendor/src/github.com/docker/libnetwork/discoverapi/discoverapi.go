@@ -0,0 +1,44 @@
+// Package discoverapi defines the notifications libnetwork's driver/ipam
+// plugins receive when the daemon's view of cluster state changes.
+package discoverapi
+
+// DiscoveryType represents the type of discovery notification being sent
+type DiscoveryType int
+
+const (
+	// NodeDiscovery represents Node join/leave notifications
+	NodeDiscovery = iota
+	// DatastoreConfig represents a notification for new datastore config
+	DatastoreConfig
+	// EncryptionKeysConfig represents a notification that keys are configured
+	EncryptionKeysConfig
+	// EncryptionKeysUpdate represents a notification for updates to keys
+	EncryptionKeysUpdate
+)
+
+// NodeDiscoveryData represents the structure backing the node discovery data
+type NodeDiscoveryData struct {
+	Address     string
+	BindAddress string
+	Self        bool
+}
+
+// DatastoreConfigData is the data for the datastore update event message
+type DatastoreConfigData struct {
+	Scope    string
+	Provider string
+	Address  string
+	Config   interface{}
+}
+
+// Discover is the interface the drivers and ipam plugins must implement to
+// get notifications from libnetwork
+type Discover interface {
+	// DiscoverNew is a notification for a new discovery event, Example:
+	// new node joining a cluster
+	DiscoverNew(dType DiscoveryType, data interface{}) error
+
+	// DiscoverDelete is a notification for a discovery delete event,
+	// Example: node leaving a cluster
+	DiscoverDelete(dType DiscoveryType, data interface{}) error
+}
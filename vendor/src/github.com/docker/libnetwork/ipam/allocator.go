@@ -33,12 +33,23 @@ const (
 
 // Allocator provides per address space ipv4/ipv6 book keeping
 type Allocator struct {
-	// Predefined pools for default address spaces
-	predefined map[string][]*net.IPNet
+	// Predefined pools for default address spaces, expressed as base
+	// CIDRs to split on demand rather than a materialized subnet list
+	predefined map[string][]*ipamutils.NetworkToSplit
 	addrSpaces map[string]*addrSpace
 	// stores        []datastore.Datastore
 	// Allocated addresses in each address space's subnet
 	addresses map[SubnetKey]*bitseq.Handle
+	// predefinedReserved tracks, per address space, the predefined pools
+	// that a concurrent RequestPool call has picked but not yet committed
+	// to the store. getPredefinedPool consults and updates this set under
+	// the same lock so two callers racing with no user-supplied pool can
+	// never return the same candidate.
+	predefinedReserved map[string]map[string]bool
+	// predefinedConfigured tracks which address spaces have had their
+	// predefined pool list explicitly set via ConfigureDefaultAddressPool,
+	// so the local scope (unlike global) can only be configured once.
+	predefinedConfigured map[string]bool
 	sync.Mutex
 }
 
@@ -47,7 +58,7 @@ func NewAllocator(lcDs, glDs datastore.DataStore) (*Allocator, error) {
 	a := &Allocator{}
 
 	// Load predefined subnet pools
-	a.predefined = map[string][]*net.IPNet{
+	a.predefined = map[string][]*ipamutils.NetworkToSplit{
 		localAddressSpace:  ipamutils.PredefinedBroadNetworks,
 		globalAddressSpace: ipamutils.PredefinedGranularNetworks,
 	}
@@ -84,6 +95,17 @@ func (a *Allocator) refresh(as string) error {
 	a.addrSpaces[as] = aSpace
 	a.Unlock()
 
+	// The global scope's default pool list is shared cluster state:
+	// pick up whatever the last ConfigureDefaultAddressPool call wrote,
+	// so every swarm node resolves predefined pools the same way.
+	if as == globalAddressSpace {
+		a.loadDefaultPoolConfig(as, aSpace)
+	}
+
+	// Re-attach the renewal goroutine to any DHCP lease this process
+	// did not itself negotiate (e.g. one bound before a daemon restart).
+	a.rebindDHCPLeases(aSpace)
+
 	return nil
 }
 
@@ -209,18 +231,14 @@ func (a *Allocator) RequestPool(addressSpace, pool, subPool string, options map[
 	log.Debugf("RequestPool(%s, %s, %s, %v, %t)", addressSpace, pool, subPool, options, v6)
 retry:
 
-
-	dp := &addrSpace{
-		dhcpLeases: dhcpLeaseTable{},
-	}
-
+	var dhcpIface string
 	for option, value := range options {
 		switch option {
 		case dhcpInterface:
 			// parse DHCP interface option '--ipam-opt dhcp_interface=eth0'
-			dp.DhcpInterface = value
-			}
+			dhcpIface = value
 		}
+	}
 
 	k, nw, ipr, pdf, err := a.parsePoolRequest(addressSpace, pool, subPool, v6)
 	if err != nil {
@@ -228,16 +246,25 @@ retry:
 	}
 
 	if err := a.refresh(addressSpace); err != nil {
+		if pdf {
+			a.releasePredefinedReservation(addressSpace, nw)
+		}
 		return "", nil, nil, err
 	}
 
 	aSpace, err := a.getAddrSpace(addressSpace)
 	if err != nil {
+		if pdf {
+			a.releasePredefinedReservation(addressSpace, nw)
+		}
 		return "", nil, nil, err
 	}
 
-	insert, err := aSpace.updatePoolDBOnAdd(*k, nw, ipr, pdf)
+	insert, err := aSpace.updatePoolDBOnAdd(*k, nw, ipr, pdf, dhcpIface)
 	if err != nil {
+		if pdf {
+			a.releasePredefinedReservation(addressSpace, nw)
+		}
 		if _, ok := err.(types.MaskableError); ok {
 			log.Debugf("Retrying predefined pool search: %v", err)
 			goto retry
@@ -247,13 +274,23 @@ retry:
 
 	if err := a.writeToStore(aSpace); err != nil {
 		if _, ok := err.(types.RetryError); !ok {
+			if pdf {
+				a.releasePredefinedReservation(addressSpace, nw)
+			}
 			return "", nil, nil, types.InternalErrorf("pool configuration failed because of %s", err.Error())
 		}
 
+		if pdf {
+			a.releasePredefinedReservation(addressSpace, nw)
+		}
 		goto retry
 	}
 
-	return k.String(), nw, nil, insert()
+	insertErr := insert()
+	if pdf {
+		a.releasePredefinedReservation(addressSpace, nw)
+	}
+	return k.String(), nw, nil, insertErr
 }
 
 
@@ -326,6 +363,9 @@ func (a *Allocator) parsePoolRequest(addressSpace, pool, subPool string, v6 bool
 		if _, nw, err = net.ParseCIDR(pool); err != nil {
 			return nil, nil, nil, false, ipamapi.ErrInvalidPool
 		}
+		if err = requireCanonicalPool(nw); err != nil {
+			return nil, nil, nil, false, err
+		}
 		if subPool != "" {
 			if ipr, err = getAddressRange(subPool, nw); err != nil {
 				return nil, nil, nil, false, err
@@ -391,16 +431,22 @@ func (a *Allocator) retrieveBitmask(k SubnetKey, n *net.IPNet) (*bitseq.Handle,
 	return bm, nil
 }
 
-func (a *Allocator) getPredefineds(as string) []*net.IPNet {
+func (a *Allocator) getPredefineds(as string) []*ipamutils.NetworkToSplit {
 	a.Lock()
 	defer a.Unlock()
-	l := make([]*net.IPNet, 0, len(a.predefined[as]))
+	l := make([]*ipamutils.NetworkToSplit, 0, len(a.predefined[as]))
 	for _, pool := range a.predefined[as] {
 		l = append(l, pool)
 	}
 	return l
 }
 
+// getPredefinedPool picks the next available subnet among the address
+// space's configured default pools. Each configured pool is a base CIDR
+// plus a split size (see ipamutils.NetworkToSplit); candidates are
+// generated from it on demand with ipamutils.SplitNetwork rather than
+// materialized up front, since a single /8 split into /24s is 65536
+// candidates.
 func (a *Allocator) getPredefinedPool(as string, ipV6 bool) (*net.IPNet, error) {
 	var v ipVersion
 	v = v4
@@ -417,18 +463,61 @@ func (a *Allocator) getPredefinedPool(as string, ipV6 bool) (*net.IPNet, error)
 		return nil, err
 	}
 
-	for _, nw := range a.getPredefineds(as) {
-		if v != getAddressVersion(nw.IP) {
-			continue
-		}
-		aSpace.Lock()
-		_, ok := aSpace.subnets[SubnetKey{AddressSpace: as, Subnet: nw.String()}]
-		aSpace.Unlock()
-		if ok {
+	predefineds := a.getPredefineds(as)
+
+	// The allocator lock (a.Lock()) and the address space lock
+	// (aSpace.Lock()) must never be held at the same time: the commit
+	// closure of updatePoolDBOnRemoval (store.go), which ReleasePool runs,
+	// takes them in aSpace -> a order, so
+	// taking them in a -> aSpace order here would AB-BA deadlock against
+	// a concurrent ReleasePool. Instead, the candidate scan below drops
+	// a.Lock() before ever taking aSpace.Lock(), and re-checks the
+	// reservation under a.Lock() once more right before committing, so a
+	// candidate can never be handed out to two callers even though the
+	// scan itself isn't atomic with the reservation.
+	for _, spec := range predefineds {
+		if v != getAddressVersion(spec.Base.IP) {
 			continue
 		}
 
-		if !aSpace.contains(as, nw) {
+		for i := 0; ; i++ {
+			nw, ok := ipamutils.SplitNetwork(spec, i)
+			if !ok {
+				break
+			}
+
+			key := nw.String()
+
+			a.Lock()
+			if a.predefinedReserved == nil {
+				a.predefinedReserved = map[string]map[string]bool{}
+			}
+			alreadyReserved := a.predefinedReserved[as][key]
+			a.Unlock()
+			if alreadyReserved {
+				continue
+			}
+
+			aSpace.Lock()
+			_, exists := aSpace.subnets[SubnetKey{AddressSpace: as, Subnet: key}]
+			overlaps := aSpace.contains(as, nw)
+			aSpace.Unlock()
+			if exists || overlaps {
+				continue
+			}
+
+			a.Lock()
+			reserved := a.predefinedReserved[as]
+			if reserved[key] {
+				a.Unlock()
+				continue
+			}
+			if reserved == nil {
+				reserved = map[string]bool{}
+				a.predefinedReserved[as] = reserved
+			}
+			reserved[key] = true
+			a.Unlock()
 			return nw, nil
 		}
 	}
@@ -436,6 +525,19 @@ func (a *Allocator) getPredefinedPool(as string, ipV6 bool) (*net.IPNet, error)
 	return nil, types.NotFoundErrorf("could not find an available, non-overlapping IPv%d address pool among the defaults to assign to the network", v)
 }
 
+// releasePredefinedReservation clears the in-memory reservation taken by
+// getPredefinedPool for nw, either because the RequestPool call that
+// reserved it failed and will retry with a different candidate, or because
+// it succeeded and the pool is now durably recorded in aSpace.subnets (and
+// no longer needs a placeholder to keep other callers from picking it).
+func (a *Allocator) releasePredefinedReservation(as string, nw *net.IPNet) {
+	a.Lock()
+	defer a.Unlock()
+	if reserved, ok := a.predefinedReserved[as]; ok {
+		delete(reserved, nw.String())
+	}
+}
+
 // RequestAddress returns an address from the specified pool ID
 func (a *Allocator) RequestAddress(poolID string, prefAddress net.IP, opts map[string]string) (*net.IPNet, map[string]string, error) {
 	log.Debugf("RequestAddress(%s, %v, %v)", poolID, prefAddress, opts)
@@ -478,23 +580,22 @@ func (a *Allocator) RequestAddress(poolID string, prefAddress net.IP, opts map[s
 			k.String(), prefAddress, poolID, err)
 	}
 
-	//macAddr := opts[netlabel.MacAddress]
-
-	//if len(macAddr) <= 0 {
-	//	return nil, nil, fmt.Errorf("no mac address found in the request address call")
-	//}
+	dhcpIface := opts["dhcp_interface"]
+	if dhcpIface == "" {
+		dhcpIface = p.DhcpInterface
+	}
 
-	if len(opts["dhcp_interface"]) > 0 && len(opts["com.docker.network.endpoint.macaddress"]) > 0 {
-			if !parentExists(opts["dhcp_interface"]) {
+	if len(dhcpIface) > 0 && len(opts["com.docker.network.endpoint.macaddress"]) > 0 {
+			if !parentExists(dhcpIface) {
 				// if the subinterface parent_iface.vlan_id checks do not pass, return err.
 				//  a valid example is 'eth0.10' for a parent iface 'eth0' with a vlan id '10'
-				err := createVlanLink(opts["dhcp_interface"])
+				err := createVlanLink(dhcpIface)
 				if err != nil {
-					return nil, nil, fmt.Errorf("failed to create the %s subinterface: %v", opts["dhcp_interface"], err)
+					return nil, nil, fmt.Errorf("failed to create the %s subinterface: %v", dhcpIface, err)
 				}
 			}
 
-			ip, err := requestDHCPLease(opts["com.docker.network.endpoint.macaddress"], opts["dhcp_interface"])
+			ip, err := a.requestDHCPLease(aSpace, poolID, c.Pool, bm, opts["com.docker.network.endpoint.macaddress"], dhcpIface)
 			log.Debugf("lcb-20170220-0003:%v", ip)
 			if err != nil {
 				return nil, nil, err
@@ -620,9 +721,13 @@ func (a *Allocator) ReleaseAddress(poolID string, address net.IP) error {
 	}
 	aSpace.Unlock()
 
-	mask := p.Pool.Mask
-
+	if released, err := a.releaseDHCPLease(aSpace, address); err != nil {
+		return types.InternalErrorf("failed to release dhcp lease for %s: %v", address, err)
+	} else if released {
+		return nil
+	}
 
+	mask := p.Pool.Mask
 
 	h, err := types.GetHostPartIP(address, mask)
 	if err != nil {
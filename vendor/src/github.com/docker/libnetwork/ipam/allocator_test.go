@@ -0,0 +1,46 @@
+package ipam
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestRequestPoolConcurrentPredefined spins up concurrent RequestPool calls
+// against the same address space with no explicit pool, and asserts that
+// every caller gets a distinct predefined subnet back.
+func TestRequestPoolConcurrentPredefined(t *testing.T) {
+	a, err := NewAllocator(nil, nil)
+	if err != nil {
+		t.Fatalf("NewAllocator failed: %v", err)
+	}
+
+	const n = 20
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		subnets = map[string]bool{}
+	)
+
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+
+			_, nw, _, err := a.RequestPool(localAddressSpace, "", "", nil, false)
+			if err != nil {
+				t.Errorf("RequestPool failed: %v", err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			subnets[nw.String()] = true
+		}()
+	}
+	wg.Wait()
+
+	if len(subnets) != n {
+		t.Fatalf("expected %d distinct subnets, got %d: %v", n, len(subnets), subnets)
+	}
+}
@@ -0,0 +1,159 @@
+package ipam
+
+// defaultpool.go lets operators replace the built-in predefined address
+// pools (see ipamutils) on a live Allocator, and keeps the global scope's
+// choice in sync across a swarm through the global datastore.
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/ipamutils"
+	"github.com/docker/libnetwork/types"
+)
+
+const dsDefaultPoolsKey = "ipam/" + ipamapi.DefaultIPAM + "/defaultpools"
+
+// ConfigureDefaultAddressPool overrides the base CIDRs RequestPool draws
+// from when called with no explicit pool, for the address space matching
+// scope. The local scope reflects a single daemon's own defaults and may
+// only be set once per process lifetime; the global scope backs swarm
+// networks and may be reconfigured at any time so long as doing so would
+// not strand an already-allocated subnet outside the new pool list.
+func (a *Allocator) ConfigureDefaultAddressPool(scope string, pools []*ipamutils.NetworkToSplit) error {
+	var as string
+	switch scope {
+	case datastore.LocalScope:
+		as = localAddressSpace
+	case datastore.GlobalScope:
+		as = globalAddressSpace
+	default:
+		return types.BadRequestErrorf("invalid scope %q for default address pool configuration", scope)
+	}
+
+	if len(pools) == 0 {
+		return types.BadRequestErrorf("default address pool configuration requires at least one pool")
+	}
+
+	a.Lock()
+	if as == localAddressSpace && a.predefinedConfigured[as] {
+		a.Unlock()
+		return types.ForbiddenErrorf("local default address pool has already been initialized and cannot be reconfigured")
+	}
+	a.Unlock()
+
+	aSpace, err := a.getAddrSpace(as)
+	if err != nil {
+		return err
+	}
+
+	if err := validateDefaultPoolChange(aSpace, pools); err != nil {
+		return err
+	}
+
+	a.Lock()
+	a.predefined[as] = pools
+	if a.predefinedConfigured == nil {
+		a.predefinedConfigured = map[string]bool{}
+	}
+	a.predefinedConfigured[as] = true
+	if a.predefinedReserved != nil {
+		delete(a.predefinedReserved, as)
+	}
+	a.Unlock()
+
+	if as != globalAddressSpace {
+		return nil
+	}
+	return a.writeDefaultPoolConfig(aSpace, pools)
+}
+
+// validateDefaultPoolChange rejects a pool list that would no longer cover
+// a subnet this address space already handed out from its defaults.
+func validateDefaultPoolChange(aSpace *addrSpace, pools []*ipamutils.NetworkToSplit) error {
+	aSpace.Lock()
+	defer aSpace.Unlock()
+
+	for k, pd := range aSpace.subnets {
+		if !pd.Predefined {
+			continue
+		}
+		covered := false
+		for _, p := range pools {
+			if p.Base.Contains(pd.Pool.IP) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return types.ForbiddenErrorf("cannot reconfigure default address pools: already-allocated subnet %s would no longer be covered", k.Subnet)
+		}
+	}
+	return nil
+}
+
+// writeDefaultPoolConfig persists the global scope's pool list to the
+// global datastore so other swarm nodes pick it up on their next refresh.
+func (a *Allocator) writeDefaultPoolConfig(aSpace *addrSpace, pools []*ipamutils.NetworkToSplit) error {
+	if aSpace.ds == nil {
+		return nil
+	}
+	return aSpace.ds.PutObjectAtomic(&defaultPoolsKV{as: aSpace.id, Pools: pools})
+}
+
+// loadDefaultPoolConfig reloads as's pool list from its backing datastore,
+// applying it locally if present. It is a no-op for address spaces with no
+// backing datastore or no persisted configuration.
+func (a *Allocator) loadDefaultPoolConfig(as string, aSpace *addrSpace) {
+	if aSpace.ds == nil {
+		return
+	}
+
+	kv := &defaultPoolsKV{as: aSpace.id}
+	if err := aSpace.ds.GetObject(datastore.Key(kv.Key()...), kv); err != nil {
+		if err != datastore.ErrKeyNotFound {
+			log.Warnf("failed to load default address pool config for %s: %v", aSpace.id, err)
+		}
+		return
+	}
+
+	a.Lock()
+	a.predefined[as] = kv.Pools
+	a.Unlock()
+}
+
+// defaultPoolsKV adapts a []*ipamutils.NetworkToSplit to datastore.KVObject.
+type defaultPoolsKV struct {
+	as    string
+	Pools []*ipamutils.NetworkToSplit
+	index uint64
+}
+
+func (d *defaultPoolsKV) Key() []string       { return []string{dsDefaultPoolsKey, d.as} }
+func (d *defaultPoolsKV) KeyPrefix() []string { return []string{dsDefaultPoolsKey} }
+func (d *defaultPoolsKV) Value() []byte {
+	b, err := json.Marshal(d.Pools)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+func (d *defaultPoolsKV) SetValue(value []byte) error { return json.Unmarshal(value, &d.Pools) }
+func (d *defaultPoolsKV) Index() uint64               { return d.index }
+func (d *defaultPoolsKV) SetIndex(index uint64)       { d.index = index }
+func (d *defaultPoolsKV) Exists() bool                { return d.index != 0 }
+func (d *defaultPoolsKV) Skip() bool                  { return false }
+func (d *defaultPoolsKV) New() datastore.KVObject     { return &defaultPoolsKV{as: d.as} }
+func (d *defaultPoolsKV) CopyTo(o datastore.KVObject) error {
+	dst, ok := o.(*defaultPoolsKV)
+	if !ok {
+		return fmt.Errorf("invalid destination object type %T for defaultPoolsKV.CopyTo", o)
+	}
+	dst.as = d.as
+	dst.Pools = d.Pools
+	return nil
+}
+func (d *defaultPoolsKV) DataScope() string { return datastore.GlobalScope }
@@ -0,0 +1,734 @@
+package ipam
+
+// dhcp.go implements the DHCPv4 client lifecycle backing pools that were
+// requested with `--ipam-opt dhcp_interface=<iface>`: obtaining a lease
+// (DISCOVER/OFFER/REQUEST/ACK), renewing it at T1/T2 per RFC 2131 for as
+// long as the allocation is held, and releasing it back to the server when
+// the corresponding address is released.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/bitseq"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/types"
+)
+
+const (
+	dsDhcpLeasesKey = "ipam/dhcp/leases"
+
+	dhcpServerPort = 67
+	dhcpClientPort = 68
+
+	bootRequest = 1
+	bootReply   = 2
+
+	dhcpDiscover = 1
+	dhcpOffer    = 2
+	dhcpRequest  = 3
+	dhcpAck      = 5
+	dhcpNak      = 6
+	dhcpRelease  = 7
+
+	optMessageType = 53
+	optServerID    = 54
+	optRequestedIP = 50
+	optLeaseTime   = 51
+	optRenewalT1   = 58
+	optRebindingT2 = 59
+	optEnd         = 255
+)
+
+// dhcpLease is a lease bound to a single container endpoint's MAC/pool
+// allocation. It is persisted to the datastore under dsDhcpLeasesKey so it
+// can be re-bound (not re-discovered) across daemon restarts.
+type dhcpLease struct {
+	PoolID    string    `json:"pool_id"`
+	MAC       string    `json:"mac"`
+	IP        net.IP    `json:"ip"`
+	ServerID  net.IP    `json:"server_id"`
+	Iface     string    `json:"iface"`
+	XID       uint32    `json:"xid"`
+	LeaseTime uint32    `json:"lease_time"`
+	T1        uint32    `json:"t1"`
+	T2        uint32    `json:"t2"`
+	BoundAt   time.Time `json:"bound_at"`
+
+	stop chan struct{} `json:"-"`
+}
+
+// dhcpLeaseTable indexes outstanding leases for an address space by leased
+// IP string, so ReleaseAddress and refresh can find a lease without
+// scanning every pool.
+type dhcpLeaseTable map[string]*dhcpLease
+
+// requestDHCPLease runs a DISCOVER/REQUEST exchange over iface for mac,
+// records the resulting lease in aSpace and the datastore, marks the leased
+// address unavailable in the pool's bitmask and starts the T1/T2 renewal
+// goroutine. It returns the leased IP.
+func (a *Allocator) requestDHCPLease(aSpace *addrSpace, poolID string, pool *net.IPNet, bm *bitseq.Handle, mac, iface string) (net.IP, error) {
+	lease, err := dhcpNegotiate(mac, iface)
+	if err != nil {
+		return nil, types.InternalErrorf("dhcp lease request on %s for %s failed: %v", iface, mac, err)
+	}
+	lease.PoolID = poolID
+
+	if bm != nil {
+		hostPart, err := types.GetHostPartIP(lease.IP, pool.Mask)
+		if err != nil {
+			return nil, types.InternalErrorf("dhcp address %s is not part of pool %s: %v", lease.IP, pool, err)
+		}
+		if err := bm.Set(ipToUint64(hostPart)); err != nil {
+			return nil, types.InternalErrorf("dhcp address %s conflicts with an existing allocation: %v", lease.IP, err)
+		}
+	}
+
+	aSpace.Lock()
+	if aSpace.dhcpLeases == nil {
+		aSpace.dhcpLeases = dhcpLeaseTable{}
+	}
+	aSpace.dhcpLeases[lease.IP.String()] = lease
+	aSpace.Unlock()
+
+	if err := a.putDHCPLease(aSpace, lease); err != nil {
+		log.Warnf("failed to persist dhcp lease for %s: %v", lease.IP, err)
+	}
+
+	a.startRenewer(aSpace, lease)
+
+	return lease.IP, nil
+}
+
+// releaseDHCPLease looks up the lease bound to address in aSpace, issues a
+// DHCPRELEASE to its server, stops its renewal goroutine, clears the
+// address's bit in its pool's bitmask and removes the lease from the
+// datastore. It returns false if address has no associated DHCP lease, so
+// the caller can fall back to normal bitmask release.
+func (a *Allocator) releaseDHCPLease(aSpace *addrSpace, address net.IP) (bool, error) {
+	aSpace.Lock()
+	lease, ok := aSpace.dhcpLeases[address.String()]
+	if ok {
+		delete(aSpace.dhcpLeases, address.String())
+	}
+	aSpace.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	if lease.stop != nil {
+		close(lease.stop)
+	}
+
+	if err := dhcpRelease_(lease); err != nil {
+		log.Warnf("DHCPRELEASE for %s failed, lease will expire naturally: %v", lease.IP, err)
+	}
+
+	if k, pool, err := lookupDHCPPool(aSpace, lease.PoolID); err != nil {
+		log.Warnf("failed to resolve pool for dhcp address %s, bitmask not released: %v", lease.IP, err)
+	} else {
+		a.Lock()
+		bm, ok := a.addresses[k]
+		a.Unlock()
+		if ok {
+			hostPart, err := types.GetHostPartIP(lease.IP, pool.Mask)
+			if err != nil {
+				log.Warnf("failed to release dhcp address %s back to the pool bitmask: %v", lease.IP, err)
+			} else if err := bm.Unset(ipToUint64(hostPart)); err != nil {
+				log.Warnf("failed to release dhcp address %s back to the pool bitmask: %v", lease.IP, err)
+			}
+		}
+	}
+
+	if err := a.deleteDHCPLease(aSpace, lease); err != nil {
+		log.Warnf("failed to remove dhcp lease record for %s: %v", lease.IP, err)
+	}
+
+	return true, nil
+}
+
+// lookupDHCPPool resolves poolID to the SubnetKey/pool its allocations are
+// actually tracked under, walking up to the parent pool for sub-pool
+// allocations exactly as RequestAddress/ReleaseAddress do.
+func lookupDHCPPool(aSpace *addrSpace, poolID string) (SubnetKey, *net.IPNet, error) {
+	k := SubnetKey{}
+	if err := k.FromString(poolID); err != nil {
+		return SubnetKey{}, nil, err
+	}
+
+	aSpace.Lock()
+	defer aSpace.Unlock()
+
+	c, ok := aSpace.subnets[k]
+	for ok && c.Range != nil {
+		k = c.ParentKey
+		c, ok = aSpace.subnets[k]
+	}
+	if !ok {
+		return SubnetKey{}, nil, types.NotFoundErrorf("cannot find address pool for poolID:%s", poolID)
+	}
+
+	return k, c.Pool, nil
+}
+
+// startRenewer launches the per-lease goroutine that renews at T1, falls
+// back to rebinding (broadcast REQUEST) at T2, and logs a failure if the
+// lease is allowed to lapse.
+func (a *Allocator) startRenewer(aSpace *addrSpace, lease *dhcpLease) {
+	lease.stop = make(chan struct{})
+
+	go func(l *dhcpLease) {
+		for {
+			t1 := time.Duration(l.T1) * time.Second
+			select {
+			case <-time.After(t1):
+			case <-l.stop:
+				return
+			}
+
+			renewed, err := dhcpRenew(l, false)
+			if err != nil {
+				log.Warnf("dhcp renewal (T1) for %s failed, will retry at T2: %v", l.IP, err)
+				t2 := time.Duration(l.T2-l.T1) * time.Second
+				select {
+				case <-time.After(t2):
+				case <-l.stop:
+					return
+				}
+				renewed, err = dhcpRenew(l, true)
+				if err != nil {
+					log.Errorf("dhcp rebinding (T2) for %s failed, lease will expire: %v", l.IP, err)
+					continue
+				}
+			}
+
+			l.LeaseTime, l.T1, l.T2, l.BoundAt = renewed.LeaseTime, renewed.T1, renewed.T2, renewed.BoundAt
+			if err := a.putDHCPLease(aSpace, l); err != nil {
+				log.Warnf("failed to persist renewed dhcp lease for %s: %v", l.IP, err)
+			}
+		}
+	}(lease)
+}
+
+// rebindDHCPLeases is invoked from refresh to load any lease persisted under
+// dsDhcpLeasesKey for aSpace and (re)attach the renewal goroutine to it.
+// This is what lets a lease negotiated by a previous daemon process survive
+// a restart instead of being silently abandoned (and leaked on the server)
+// until it expires.
+func (a *Allocator) rebindDHCPLeases(aSpace *addrSpace) {
+	if aSpace.ds == nil {
+		return
+	}
+
+	// refresh calls this on every RequestPool/RequestAddress/ReleaseAddress/
+	// ReleasePool, most of which have nothing to do with DHCP. Skip the
+	// datastore.List scan entirely for address spaces that have never
+	// configured a DHCP pool.
+	if !aSpaceHasDHCPPools(aSpace) {
+		return
+	}
+
+	kvList, err := aSpace.ds.List(datastore.Key(dsDhcpLeasesKey, aSpace.id), &dhcpLeaseKV{as: aSpace.id, lease: &dhcpLease{}})
+	if err != nil && err != datastore.ErrKeyNotFound {
+		log.Warnf("failed to load persisted dhcp leases for %s: %v", aSpace.id, err)
+		return
+	}
+
+	aSpace.Lock()
+	if aSpace.dhcpLeases == nil {
+		aSpace.dhcpLeases = dhcpLeaseTable{}
+	}
+	var toStart []*dhcpLease
+	for _, kv := range kvList {
+		lkv, ok := kv.(*dhcpLeaseKV)
+		if !ok {
+			continue
+		}
+		if _, exists := aSpace.dhcpLeases[lkv.lease.IP.String()]; exists {
+			continue
+		}
+		aSpace.dhcpLeases[lkv.lease.IP.String()] = lkv.lease
+		toStart = append(toStart, lkv.lease)
+	}
+	aSpace.Unlock()
+
+	for _, l := range toStart {
+		if err := a.markDHCPLeaseBit(aSpace, l); err != nil {
+			log.Warnf("failed to re-mark restart-surviving dhcp address %s as allocated: %v", l.IP, err)
+		}
+		a.startRenewer(aSpace, l)
+	}
+}
+
+// aSpaceHasDHCPPools reports whether any pool configured in aSpace was
+// requested with a dhcp_interface, so rebindDHCPLeases can skip its
+// datastore scan for address spaces that never use DHCP at all.
+func aSpaceHasDHCPPools(aSpace *addrSpace) bool {
+	aSpace.Lock()
+	defer aSpace.Unlock()
+	for _, p := range aSpace.subnets {
+		if p.DhcpInterface != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// markDHCPLeaseBit sets lease's address as allocated in its pool's
+// bitmask. It is used to re-establish the bit a restart-surviving lease
+// holds (rebindDHCPLeases) since only requestDHCPLease's own negotiation
+// path sets it otherwise.
+func (a *Allocator) markDHCPLeaseBit(aSpace *addrSpace, lease *dhcpLease) error {
+	k, pool, err := lookupDHCPPool(aSpace, lease.PoolID)
+	if err != nil {
+		return err
+	}
+
+	bm, err := a.retrieveBitmask(k, pool)
+	if err != nil {
+		return err
+	}
+
+	hostPart, err := types.GetHostPartIP(lease.IP, pool.Mask)
+	if err != nil {
+		return err
+	}
+
+	// Unlike requestDHCPLease's fresh negotiation, ErrBitAllocated here
+	// just means a previous rebind (or this lease's own prior bitmask
+	// commit) already marked the bit; it is not a real conflict.
+	if err := bm.Set(ipToUint64(hostPart)); err != nil && err != bitseq.ErrBitAllocated {
+		return err
+	}
+	return nil
+}
+
+// --- datastore persistence -------------------------------------------------
+
+func (a *Allocator) putDHCPLease(aSpace *addrSpace, lease *dhcpLease) error {
+	store := aSpace.ds
+	if store == nil {
+		return nil
+	}
+	return store.PutObjectAtomic(&dhcpLeaseKV{lease: lease, as: aSpace.id})
+}
+
+func (a *Allocator) deleteDHCPLease(aSpace *addrSpace, lease *dhcpLease) error {
+	store := aSpace.ds
+	if store == nil {
+		return nil
+	}
+	return store.DeleteObjectAtomic(&dhcpLeaseKV{lease: lease, as: aSpace.id})
+}
+
+// dhcpLeaseKV adapts a dhcpLease to datastore.KVObject so it can be
+// persisted independently of its owning addrSpace document.
+type dhcpLeaseKV struct {
+	lease *dhcpLease
+	as    string
+	index uint64
+}
+
+func (d *dhcpLeaseKV) Key() []string {
+	return []string{dsDhcpLeasesKey, d.as, d.lease.IP.String()}
+}
+func (d *dhcpLeaseKV) KeyPrefix() []string { return []string{dsDhcpLeasesKey, d.as} }
+func (d *dhcpLeaseKV) Value() []byte {
+	b, err := json.Marshal(d.lease)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+func (d *dhcpLeaseKV) SetValue(value []byte) error { return json.Unmarshal(value, d.lease) }
+func (d *dhcpLeaseKV) Index() uint64               { return d.index }
+func (d *dhcpLeaseKV) SetIndex(index uint64)       { d.index = index }
+func (d *dhcpLeaseKV) Exists() bool                { return d.index != 0 }
+func (d *dhcpLeaseKV) Skip() bool                  { return false }
+func (d *dhcpLeaseKV) New() datastore.KVObject     { return &dhcpLeaseKV{lease: &dhcpLease{}, as: d.as} }
+func (d *dhcpLeaseKV) CopyTo(o datastore.KVObject) error {
+	dst, ok := o.(*dhcpLeaseKV)
+	if !ok {
+		return fmt.Errorf("invalid destination object type %T for dhcpLeaseKV.CopyTo", o)
+	}
+	*dst.lease = *d.lease
+	dst.as = d.as
+	return nil
+}
+func (d *dhcpLeaseKV) DataScope() string { return datastore.GlobalScope }
+
+// --- wire protocol ----------------------------------------------------------
+
+// dhcpNegotiate performs a DISCOVER/OFFER/REQUEST/ACK exchange over iface on
+// behalf of mac and returns the resulting lease.
+func dhcpNegotiate(mac, iface string) (*dhcpLease, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mac address %q: %v", mac, err)
+	}
+
+	dc, err := acquireDHCPConn(iface)
+	if err != nil {
+		return nil, err
+	}
+	defer dc.release(iface)
+
+	xid := dhcpXID()
+
+	if err := dhcpSend(dc.conn, dhcpBuildPacket(dhcpDiscover, xid, hw, nil, nil)); err != nil {
+		return nil, fmt.Errorf("DHCPDISCOVER failed: %v", err)
+	}
+	offer, err := dhcpRecv(dc, xid, dhcpOffer)
+	if err != nil {
+		return nil, fmt.Errorf("no DHCPOFFER received: %v", err)
+	}
+
+	if err := dhcpSend(dc.conn, dhcpBuildPacket(dhcpRequest, xid, hw, offer.offeredIP, offer.serverID)); err != nil {
+		return nil, fmt.Errorf("DHCPREQUEST failed: %v", err)
+	}
+	ack, err := dhcpRecv(dc, xid, dhcpAck)
+	if err != nil {
+		return nil, fmt.Errorf("no DHCPACK received: %v", err)
+	}
+
+	return dhcpLeaseFromAck(mac, iface, xid, ack), nil
+}
+
+// dhcpRenew performs the RENEWING (server ID included) or REBINDING (no
+// server ID) exchange for an existing lease and returns its refreshed
+// terms. Both are sent to the broadcast address through dhcpSend.
+func dhcpRenew(lease *dhcpLease, rebind bool) (*dhcpLease, error) {
+	hw, err := net.ParseMAC(lease.MAC)
+	if err != nil {
+		return nil, err
+	}
+
+	dc, err := acquireDHCPConn(lease.Iface)
+	if err != nil {
+		return nil, err
+	}
+	defer dc.release(lease.Iface)
+
+	xid := dhcpXID()
+	serverID := lease.ServerID
+	if rebind {
+		serverID = nil
+	}
+
+	pkt := dhcpBuildPacket(dhcpRequest, xid, hw, lease.IP, serverID)
+	if err := dhcpSend(dc.conn, pkt); err != nil {
+		return nil, err
+	}
+
+	ack, err := dhcpRecv(dc, xid, dhcpAck)
+	if err != nil {
+		return nil, err
+	}
+
+	return dhcpLeaseFromAck(lease.MAC, lease.Iface, xid, ack), nil
+}
+
+// dhcpRelease_ issues a fire-and-forget DHCPRELEASE for lease. Named with a
+// trailing underscore to avoid colliding with the dhcpRelease message type
+// constant.
+func dhcpRelease_(lease *dhcpLease) error {
+	hw, err := net.ParseMAC(lease.MAC)
+	if err != nil {
+		return err
+	}
+
+	dc, err := acquireDHCPConn(lease.Iface)
+	if err != nil {
+		return err
+	}
+	defer dc.release(lease.Iface)
+
+	pkt := dhcpBuildPacket(dhcpRelease, dhcpXID(), hw, lease.IP, lease.ServerID)
+	return dhcpSend(dc.conn, pkt)
+}
+
+func dhcpLeaseFromAck(mac, iface string, xid uint32, ack *dhcpAckInfo) *dhcpLease {
+	leaseTime := ack.leaseTime
+	if leaseTime == 0 {
+		leaseTime = 43200 // RFC 2131 does not mandate a default; 12h matches common server behavior
+	}
+	t1 := ack.t1
+	t2 := ack.t2
+	if t1 == 0 {
+		t1 = leaseTime / 2 // RFC 2131 4.4.5 default T1
+	}
+	if t2 == 0 {
+		t2 = leaseTime * 7 / 8 // RFC 2131 4.4.5 default T2
+	}
+
+	return &dhcpLease{
+		MAC:       mac,
+		IP:        ack.offeredIP,
+		ServerID:  ack.serverID,
+		Iface:     iface,
+		XID:       xid,
+		LeaseTime: leaseTime,
+		T1:        t1,
+		T2:        t2,
+		BoundAt:   time.Now(),
+	}
+}
+
+// dhcpXID generates a pseudo-random DHCP transaction id.
+func dhcpXID() uint32 {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return uint32(time.Now().UnixNano())
+	}
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// dhcpConns holds one shared client socket per interface. DISCOVER/REQUEST/
+// RELEASE exchanges for every lease on that interface (including concurrent
+// ones, and renewals racing a fresh negotiation) share it instead of each
+// binding its own socket to the well-known client port 68 — a second bind
+// there fails outright, and on most hosts the port is already held by the
+// system's own DHCP client (dhclient, systemd-networkd) besides.
+var (
+	dhcpConnsMu sync.Mutex
+	dhcpConns   = map[string]*dhcpConn{}
+)
+
+// dhcpConn is a refcounted wrapper around the shared client socket for one
+// interface. Its readLoop demultiplexes inbound packets by DHCP transaction
+// id (xid) to whichever in-flight exchange registered that xid, so callers
+// no longer each need their own read deadline on a socket they don't own
+// exclusively.
+type dhcpConn struct {
+	conn     *net.UDPConn
+	refCount int
+
+	mu      sync.Mutex
+	waiters map[uint32]chan []byte
+}
+
+// acquireDHCPConn returns the shared client socket for iface, binding it
+// (SO_BROADCAST, SO_BINDTODEVICE) and starting its demux reader on first
+// use. Callers must call release(iface) exactly once when done; the socket
+// is only closed once every acquirer has released it.
+func acquireDHCPConn(iface string) (*dhcpConn, error) {
+	dhcpConnsMu.Lock()
+	defer dhcpConnsMu.Unlock()
+
+	if dc, ok := dhcpConns[iface]; ok {
+		dc.refCount++
+		return dc, nil
+	}
+
+	conn, err := bindDHCPClientSocket(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	dc := &dhcpConn{conn: conn, refCount: 1, waiters: map[uint32]chan []byte{}}
+	dhcpConns[iface] = dc
+	go dc.readLoop()
+	return dc, nil
+}
+
+func (dc *dhcpConn) release(iface string) {
+	dhcpConnsMu.Lock()
+	defer dhcpConnsMu.Unlock()
+
+	dc.refCount--
+	if dc.refCount > 0 {
+		return
+	}
+	delete(dhcpConns, iface)
+	dc.conn.Close()
+}
+
+// readLoop demultiplexes every packet read off dc.conn to the waiter
+// registered for its xid, if any, and returns once dc.conn is closed.
+func (dc *dhcpConn) readLoop() {
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := dc.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if n < 240 {
+			continue
+		}
+
+		dc.mu.Lock()
+		ch, ok := dc.waiters[binary.BigEndian.Uint32(buf[4:8])]
+		dc.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		pkt := append([]byte(nil), buf[:n]...)
+		select {
+		case ch <- pkt:
+		default:
+		}
+	}
+}
+
+func (dc *dhcpConn) register(xid uint32) chan []byte {
+	ch := make(chan []byte, 4)
+	dc.mu.Lock()
+	dc.waiters[xid] = ch
+	dc.mu.Unlock()
+	return ch
+}
+
+func (dc *dhcpConn) unregister(xid uint32) {
+	dc.mu.Lock()
+	delete(dc.waiters, xid)
+	dc.mu.Unlock()
+}
+
+// bindDHCPClientSocket opens the UDP socket DHCP exchanges on iface are sent
+// and received over. It sets SO_BINDTODEVICE to iface so outgoing traffic
+// leaves through dhcp_interface specifically rather than whatever the host's
+// routing table would otherwise pick, and SO_BROADCAST, which a plain
+// net.ListenUDP does not enable and DHCPDISCOVER/REQUEST/RELEASE all need in
+// order to reach net.IPv4bcast.
+func bindDHCPClientSocket(iface string) (*net.UDPConn, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, fmt.Errorf("dhcp_interface %q not found: %v", iface, err)
+	}
+
+	var sockErr error
+	lc := net.ListenConfig{
+		Control: func(_, _ string, c syscall.RawConn) error {
+			ctrlErr := c.Control(func(fd uintptr) {
+				if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1); sockErr != nil {
+					return
+				}
+				sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, ifi.Name)
+			})
+			if ctrlErr != nil {
+				return ctrlErr
+			}
+			return sockErr
+		},
+	}
+
+	pc, err := lc.ListenPacket(context.Background(), "udp4", fmt.Sprintf(":%d", dhcpClientPort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind dhcp client socket on %s: %v", iface, err)
+	}
+	return pc.(*net.UDPConn), nil
+}
+
+func dhcpSend(conn *net.UDPConn, pkt []byte) error {
+	_, err := conn.WriteToUDP(pkt, &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpServerPort})
+	return err
+}
+
+// dhcpRecv waits for a packet matching xid and msgType on dc, or times out.
+func dhcpRecv(dc *dhcpConn, xid uint32, msgType byte) (*dhcpAckInfo, error) {
+	ch := dc.register(xid)
+	defer dc.unregister(xid)
+
+	deadline := time.After(10 * time.Second)
+	for {
+		select {
+		case pkt := <-ch:
+			info := dhcpParsePacket(pkt)
+			if info == nil || info.msgType != msgType {
+				continue
+			}
+			return info, nil
+		case <-deadline:
+			return nil, fmt.Errorf("timed out waiting for a reply to xid %08x", xid)
+		}
+	}
+}
+
+// dhcpAckInfo is the subset of an OFFER/ACK this client cares about.
+type dhcpAckInfo struct {
+	msgType   byte
+	offeredIP net.IP
+	serverID  net.IP
+	leaseTime uint32
+	t1, t2    uint32
+}
+
+func dhcpBuildPacket(msgType byte, xid uint32, hw net.HardwareAddr, requestedIP, serverID net.IP) []byte {
+	pkt := make([]byte, 240)
+	pkt[0] = bootRequest
+	pkt[1] = 1 // htype: ethernet
+	pkt[2] = byte(len(hw))
+	binary.BigEndian.PutUint32(pkt[4:8], xid)
+	copy(pkt[28:28+len(hw)], hw)
+	copy(pkt[236:240], []byte{99, 130, 83, 99}) // magic cookie
+
+	opts := []byte{optMessageType, 1, msgType}
+	if requestedIP != nil {
+		ip4 := requestedIP.To4()
+		opts = append(opts, optRequestedIP, 4)
+		opts = append(opts, ip4...)
+	}
+	if serverID != nil {
+		ip4 := serverID.To4()
+		opts = append(opts, optServerID, 4)
+		opts = append(opts, ip4...)
+	}
+	opts = append(opts, optEnd)
+
+	return append(pkt, opts...)
+}
+
+func dhcpParsePacket(buf []byte) *dhcpAckInfo {
+	if len(buf) < 240 {
+		return nil
+	}
+	info := &dhcpAckInfo{offeredIP: net.IP(append([]byte(nil), buf[16:20]...))}
+
+	i := 240
+	for i < len(buf) {
+		opt := buf[i]
+		if opt == optEnd {
+			break
+		}
+		if i+1 >= len(buf) {
+			break
+		}
+		l := int(buf[i+1])
+		if i+2+l > len(buf) {
+			break
+		}
+		val := buf[i+2 : i+2+l]
+		switch opt {
+		case optMessageType:
+			if l == 1 {
+				info.msgType = val[0]
+			}
+		case optServerID:
+			info.serverID = net.IP(append([]byte(nil), val...))
+		case optLeaseTime:
+			if l == 4 {
+				info.leaseTime = binary.BigEndian.Uint32(val)
+			}
+		case optRenewalT1:
+			if l == 4 {
+				info.t1 = binary.BigEndian.Uint32(val)
+			}
+		case optRebindingT2:
+			if l == 4 {
+				info.t2 = binary.BigEndian.Uint32(val)
+			}
+		}
+		i += 2 + l
+	}
+
+	return info
+}
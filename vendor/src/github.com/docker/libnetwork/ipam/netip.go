@@ -0,0 +1,85 @@
+package ipam
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/docker/libnetwork/ipamapi"
+)
+
+// netip.go holds the netip.Addr based ordinal fast path used by ipToUint64
+// and generateAddress, plus the netip.Prefix canonical-form check used by
+// parsePoolRequest. This is a partial, additive move toward netip: SubnetKey,
+// getAddress and retrieveBitmask still take *net.IPNet/net.IP throughout, so
+// there is deliberately no netip.Prefix -> *net.IPNet adapter here yet —
+// add one only once something in the package actually holds a netip.Prefix
+// value that needs to cross back.
+
+// prefixFromIPNet adapts nw to its netip.Prefix equivalent, for the
+// canonical-form check in requireCanonicalPool. It returns false if nw
+// cannot be represented as one (e.g. a nil or malformed mask).
+func prefixFromIPNet(nw *net.IPNet) (netip.Prefix, bool) {
+	if nw == nil {
+		return netip.Prefix{}, false
+	}
+	addr, ok := netip.AddrFromSlice(nw.IP)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	ones, bits := nw.Mask.Size()
+	if bits == 0 || ones > bits {
+		return netip.Prefix{}, false
+	}
+	return netip.PrefixFrom(addr.Unmap(), ones), true
+}
+
+// requireCanonicalPool rejects a pool whose address has host bits set
+// (e.g. 10.0.0.5/8 instead of 10.0.0.0/8), so that two requests for what
+// is semantically the same subnet always collapse onto the same
+// SubnetKey instead of silently allocating two overlapping pools.
+func requireCanonicalPool(nw *net.IPNet) error {
+	p, ok := prefixFromIPNet(nw)
+	if !ok {
+		return ipamapi.ErrInvalidPool
+	}
+	if p != p.Masked() {
+		return ipamapi.ErrInvalidPool
+	}
+	return nil
+}
+
+// addrOrdinal returns the integer value of addr's bytes, taken over its
+// natural width (4 bytes for v4, 16 for v6). For v6 only the low 64 bits
+// fit in the result; higher bytes are shifted out. It performs no
+// allocation.
+func addrOrdinal(addr netip.Addr) uint64 {
+	b := addr.As16()
+	start := 0
+	if addr.Is4() {
+		start = 12
+	}
+	var res uint64
+	for i := start; i < 16; i++ {
+		res = res<<8 | uint64(b[i])
+	}
+	return res
+}
+
+// addrAddOrdinal adds ordinal to the host part of base, byte by byte from
+// the right over base's 16-byte representation, and returns the result in
+// base's address family.
+func addrAddOrdinal(base netip.Addr, ordinal uint64) netip.Addr {
+	b := base.As16()
+	start := 0
+	if base.Is4() {
+		start = 12
+	}
+	for i := 15; i >= start && ordinal > 0; i-- {
+		b[i] |= byte(ordinal & 0xff)
+		ordinal >>= 8
+	}
+	if base.Is4() {
+		return netip.AddrFrom16(b).Unmap()
+	}
+	return netip.AddrFrom16(b)
+}
@@ -0,0 +1,187 @@
+package ipam
+
+// reserve.go lets callers enumerate the sub-pools carved out of a parent
+// pool and mark static ranges within a pool (a gateway range, a reserved
+// DHCP scope, swarm ingress addresses, ...) as permanently unavailable to
+// normal allocation, without racing against RequestAddress.
+
+import (
+	"net"
+
+	"github.com/docker/libnetwork/bitseq"
+	"github.com/docker/libnetwork/types"
+)
+
+// ListSubPools returns the sub-pools that have been carved out of poolID
+// via RequestPool's subPool argument.
+func (a *Allocator) ListSubPools(poolID string) ([]SubPoolInfo, error) {
+	k := SubnetKey{}
+	if err := k.FromString(poolID); err != nil {
+		return nil, types.BadRequestErrorf("invalid pool id: %s", poolID)
+	}
+
+	aSpace, err := a.getAddrSpace(k.AddressSpace)
+	if err != nil {
+		return nil, err
+	}
+
+	parentKey := SubnetKey{AddressSpace: k.AddressSpace, Subnet: k.Subnet}
+
+	aSpace.Lock()
+	defer aSpace.Unlock()
+
+	var out []SubPoolInfo
+	for ck, p := range aSpace.subnets {
+		if ck.ChildSubnet == "" || p.ParentKey != parentKey {
+			continue
+		}
+		out = append(out, SubPoolInfo{
+			PoolID:   ck.String(),
+			Pool:     types.GetIPNetCopy(p.Pool),
+			RefCount: p.RefCount,
+		})
+	}
+
+	return out, nil
+}
+
+// ReserveRange marks the inclusive address range [start, end] of poolID as
+// permanently unavailable to normal allocation, tagged with tag for later
+// identification (e.g. by ReleaseRange or DumpDatabase). It is safe to call
+// concurrently with RequestAddress: both translate to Set calls against the
+// same bitseq.Handle, so RequestAddress does not hand out a reserved
+// address. An address in the range that is already allocated is left as
+// it is. ReleaseAddress does not consult the reservation: releasing an
+// address inside a reserved range clears its bit, and it can then be
+// handed out again.
+func (a *Allocator) ReserveRange(poolID string, start, end net.IP, tag string) error {
+	aSpace, bk, bp, p, err := a.getPoolForRange(poolID)
+	if err != nil {
+		return err
+	}
+
+	startOrd, endOrd, err := rangeOrdinals(bp.Pool, start, end)
+	if err != nil {
+		return err
+	}
+
+	bm, err := a.retrieveBitmask(bk, bp.Pool)
+	if err != nil {
+		return err
+	}
+
+	for o := startOrd; o <= endOrd; o++ {
+		if err := bm.Set(o); err != nil && err != bitseq.ErrBitAllocated {
+			return err
+		}
+	}
+
+	aSpace.Lock()
+	p.Reserved = append(p.Reserved, reservedRange{Start: startOrd, End: endOrd, Tag: tag})
+	aSpace.Unlock()
+
+	return a.writeToStore(aSpace)
+}
+
+// ReleaseRange undoes a prior ReserveRange call for the same poolID, start,
+// end and tag, returning the range's addresses to the free pool.
+func (a *Allocator) ReleaseRange(poolID string, start, end net.IP, tag string) error {
+	aSpace, bk, bp, p, err := a.getPoolForRange(poolID)
+	if err != nil {
+		return err
+	}
+
+	startOrd, endOrd, err := rangeOrdinals(bp.Pool, start, end)
+	if err != nil {
+		return err
+	}
+
+	aSpace.Lock()
+	found := -1
+	for i, r := range p.Reserved {
+		if r.Start == startOrd && r.End == endOrd && r.Tag == tag {
+			found = i
+			break
+		}
+	}
+	if found >= 0 {
+		p.Reserved = append(p.Reserved[:found], p.Reserved[found+1:]...)
+	}
+	aSpace.Unlock()
+	if found < 0 {
+		return types.NotFoundErrorf("no reserved range %s-%s tagged %q in pool %s", start, end, tag, poolID)
+	}
+
+	bm, err := a.retrieveBitmask(bk, bp.Pool)
+	if err != nil {
+		return err
+	}
+
+	for o := startOrd; o <= endOrd; o++ {
+		if err := bm.Unset(o); err != nil {
+			return err
+		}
+	}
+
+	return a.writeToStore(aSpace)
+}
+
+// getPoolForRange resolves poolID to its backing addrSpace and PoolData p,
+// and separately to the SubnetKey/PoolData that poolID's *bitmask* is
+// actually tracked under (bk/bp). For a pool requested with no subPool
+// these are the same pool; for a sub-pool, RequestAddress walks up
+// p.ParentKey to the top-level pool before ever touching a bitseq.Handle
+// (allocator.go's RequestAddress/ReleaseAddress), so reservations must walk
+// the same chain or they would Set/Unset bits in a bitmask nothing actually
+// allocates from.
+func (a *Allocator) getPoolForRange(poolID string) (*addrSpace, SubnetKey, *PoolData, *PoolData, error) {
+	k := SubnetKey{}
+	if err := k.FromString(poolID); err != nil {
+		return nil, SubnetKey{}, nil, nil, types.BadRequestErrorf("invalid pool id: %s", poolID)
+	}
+
+	aSpace, err := a.getAddrSpace(k.AddressSpace)
+	if err != nil {
+		return nil, SubnetKey{}, nil, nil, err
+	}
+
+	aSpace.Lock()
+	defer aSpace.Unlock()
+
+	p, ok := aSpace.subnets[k]
+	if !ok {
+		return nil, SubnetKey{}, nil, nil, types.NotFoundErrorf("cannot find pool %s", poolID)
+	}
+
+	bk, bp := k, p
+	for bp.Range != nil {
+		bk = bp.ParentKey
+		bp, ok = aSpace.subnets[bk]
+		if !ok {
+			return nil, SubnetKey{}, nil, nil, types.InternalErrorf("cannot find parent pool %s for pool %s", bk, poolID)
+		}
+	}
+
+	return aSpace, bk, bp, p, nil
+}
+
+// rangeOrdinals converts start and end, which must lie within pool, into
+// their ordinals relative to pool's network address.
+func rangeOrdinals(pool *net.IPNet, start, end net.IP) (uint64, uint64, error) {
+	s, err := types.GetHostPartIP(start, pool.Mask)
+	if err != nil {
+		return 0, 0, types.BadRequestErrorf("invalid range start %s: %v", start, err)
+	}
+	e, err := types.GetHostPartIP(end, pool.Mask)
+	if err != nil {
+		return 0, 0, types.BadRequestErrorf("invalid range end %s: %v", end, err)
+	}
+
+	startOrd := ipToUint64(types.GetMinimalIP(s))
+	endOrd := ipToUint64(types.GetMinimalIP(e))
+	if startOrd > endOrd {
+		return 0, 0, types.BadRequestErrorf("invalid range: start %s is after end %s", start, end)
+	}
+
+	return startOrd, endOrd, nil
+}
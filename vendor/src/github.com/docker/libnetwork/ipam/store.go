@@ -0,0 +1,247 @@
+package ipam
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/types"
+)
+
+// getStore returns the datastore backing the given address space, if any.
+func (a *Allocator) getStore(as string) datastore.DataStore {
+	a.Lock()
+	defer a.Unlock()
+	if aSpace, ok := a.addrSpaces[as]; ok {
+		return aSpace.ds
+	}
+	return nil
+}
+
+// getAddressSpaceFromStore reloads the addrSpace configuration for as from
+// its backing datastore. It returns (nil, nil) when no datastore is
+// configured for as, or when the key has not been written yet.
+func (a *Allocator) getAddressSpaceFromStore(as string) (*addrSpace, error) {
+	store := a.getStore(as)
+	if store == nil {
+		return nil, nil
+	}
+
+	pc := &addrSpace{id: dsConfigKey + "/" + as}
+	if err := store.GetObject(datastore.Key(pc.Key()...), pc); err != nil {
+		if err == datastore.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	pc.alloc = a
+	pc.ds = store
+	pc.scope = store.Scope()
+	return pc, nil
+}
+
+// writeToStore persists aSpace's pool configuration to its backing
+// datastore, if one is configured.
+func (a *Allocator) writeToStore(aSpace *addrSpace) error {
+	if aSpace.ds == nil {
+		return nil
+	}
+
+	err := aSpace.ds.PutObjectAtomic(aSpace)
+	if err == datastore.ErrKeyModified {
+		return types.RetryErrorf("failed to perform atomic write (%v). retry might fix the error", err)
+	}
+	return err
+}
+
+// KVObject interface implementation for addrSpace, so that it can be
+// persisted in the cluster-wide datastore.
+
+func (aSpace *addrSpace) Key() []string {
+	return []string{aSpace.id}
+}
+
+func (aSpace *addrSpace) KeyPrefix() []string {
+	return []string{dsConfigKey}
+}
+
+func (aSpace *addrSpace) Value() []byte {
+	aSpace.Lock()
+	defer aSpace.Unlock()
+
+	m := map[string]interface{}{}
+	subnets := make(map[string]*PoolData, len(aSpace.subnets))
+	for k, v := range aSpace.subnets {
+		subnets[k.String()] = v
+	}
+	m["subnets"] = subnets
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (aSpace *addrSpace) SetValue(value []byte) error {
+	var m map[string]interface{}
+	if err := json.Unmarshal(value, &m); err != nil {
+		return err
+	}
+
+	rawSubnets, ok := m["subnets"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	subnets := map[SubnetKey]*PoolData{}
+	for ks, rv := range rawSubnets {
+		b, err := json.Marshal(rv)
+		if err != nil {
+			return err
+		}
+		pd := &PoolData{}
+		if err := json.Unmarshal(b, pd); err != nil {
+			return err
+		}
+		k := SubnetKey{}
+		if err := k.FromString(ks); err != nil {
+			return err
+		}
+		subnets[k] = pd
+	}
+
+	aSpace.subnets = subnets
+	return nil
+}
+
+func (aSpace *addrSpace) Index() uint64 {
+	aSpace.Lock()
+	defer aSpace.Unlock()
+	return aSpace.dbIndex
+}
+
+func (aSpace *addrSpace) SetIndex(index uint64) {
+	aSpace.Lock()
+	aSpace.dbIndex = index
+	aSpace.dbExists = true
+	aSpace.Unlock()
+}
+
+func (aSpace *addrSpace) Exists() bool {
+	aSpace.Lock()
+	defer aSpace.Unlock()
+	return aSpace.dbExists
+}
+
+func (aSpace *addrSpace) Skip() bool {
+	return false
+}
+
+func (aSpace *addrSpace) New() datastore.KVObject {
+	return &addrSpace{
+		id:    aSpace.id,
+		ds:    aSpace.ds,
+		alloc: aSpace.alloc,
+	}
+}
+
+func (aSpace *addrSpace) CopyTo(o datastore.KVObject) error {
+	dst, ok := o.(*addrSpace)
+	if !ok {
+		return fmt.Errorf("invalid destination object type %T for addrSpace.CopyTo", o)
+	}
+
+	aSpace.Lock()
+	defer aSpace.Unlock()
+
+	dst.id = aSpace.id
+	dst.scope = aSpace.scope
+	dst.dbIndex = aSpace.dbIndex
+	dst.dbExists = aSpace.dbExists
+	dst.subnets = make(map[SubnetKey]*PoolData, len(aSpace.subnets))
+	for k, v := range aSpace.subnets {
+		dst.subnets[k] = v
+	}
+	return nil
+}
+
+func (aSpace *addrSpace) DataScope() string {
+	return aSpace.scope
+}
+
+// updatePoolDBOnAdd registers (or ref-counts) the pool/subPool described by
+// k, nw, ipr in aSpace and returns a commit function that must be invoked
+// only after the updated configuration has been written to the store.
+func (aSpace *addrSpace) updatePoolDBOnAdd(k SubnetKey, nw *net.IPNet, ipr *AddressRange, pdf bool, dhcpIface string) (func() error, error) {
+	aSpace.Lock()
+	defer aSpace.Unlock()
+
+	// If the pool already exists, ref count it (possible for subPool
+	// requests against an already configured parent pool).
+	if p, ok := aSpace.subnets[k]; ok {
+		p.RefCount++
+		return func() error { return nil }, nil
+	}
+
+	if pdf && aSpace.contains(k.AddressSpace, nw) {
+		return nil, types.MaskableErrorf("predefined pool %s overlaps with an existing subnet", nw)
+	}
+
+	p := &PoolData{
+		Pool:          nw,
+		RefCount:      1,
+		Predefined:    pdf,
+		DhcpInterface: dhcpIface,
+	}
+
+	if ipr != nil {
+		parentKey := SubnetKey{AddressSpace: k.AddressSpace, Subnet: k.Subnet}
+		parent, ok := aSpace.subnets[parentKey]
+		if !ok {
+			return nil, types.InternalErrorf("cannot find parent pool %s for sub pool %s", parentKey, k)
+		}
+		parent.RefCount++
+		p.ParentKey = parentKey
+		p.Pool = ipr.Sub
+		p.Range = ipr
+	}
+
+	return func() error {
+		aSpace.Lock()
+		aSpace.subnets[k] = p
+		aSpace.Unlock()
+		return nil
+	}, nil
+}
+
+// updatePoolDBOnRemoval un-ref-counts (and, when the ref count reaches zero,
+// removes) the pool identified by k. It returns a commit function that must
+// be invoked only after the updated configuration has been written to the
+// store.
+func (aSpace *addrSpace) updatePoolDBOnRemoval(k SubnetKey) (func() error, error) {
+	aSpace.Lock()
+	defer aSpace.Unlock()
+
+	p, ok := aSpace.subnets[k]
+	if !ok {
+		return nil, types.NotFoundErrorf("cannot find pool %s", k)
+	}
+
+	return func() error {
+		aSpace.Lock()
+		defer aSpace.Unlock()
+		p.RefCount--
+		if p.RefCount <= 0 {
+			delete(aSpace.subnets, k)
+			if aSpace.alloc != nil {
+				aSpace.alloc.Lock()
+				delete(aSpace.alloc.addresses, k)
+				aSpace.alloc.Unlock()
+			}
+		}
+		return nil
+	}, nil
+}
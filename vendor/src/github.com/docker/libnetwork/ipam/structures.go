@@ -0,0 +1,176 @@
+package ipam
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/types"
+)
+
+// ipVersion is used to distinguish v4/v6 address pools
+type ipVersion int
+
+const (
+	v4 ipVersion = 4
+	v6 ipVersion = 6
+)
+
+// SubnetKey is the pointer to the configured pools in each address space
+type SubnetKey struct {
+	AddressSpace string
+	Subnet       string
+	ChildSubnet  string
+}
+
+// String returns the string form of the SubnetKey object
+func (s *SubnetKey) String() string {
+	k := fmt.Sprintf("%s/%s", s.AddressSpace, s.Subnet)
+	if s.ChildSubnet != "" {
+		k = fmt.Sprintf("%s/%s", k, s.ChildSubnet)
+	}
+	return k
+}
+
+// FromString populates the SubnetKey object from the given string
+func (s *SubnetKey) FromString(str string) error {
+	if str == "" || !strings.Contains(str, "/") {
+		return types.BadRequestErrorf("invalid string form for subnetkey: %s", str)
+	}
+
+	p := strings.Split(str, "/")
+	if len(p) != 3 && len(p) != 5 {
+		return types.BadRequestErrorf("invalid string form for subnetkey: %s", str)
+	}
+
+	s.AddressSpace = p[0]
+	s.Subnet = fmt.Sprintf("%s/%s", p[1], p[2])
+	if len(p) == 5 {
+		s.ChildSubnet = fmt.Sprintf("%s/%s", p[3], p[4])
+	}
+
+	return nil
+}
+
+// AddressRange specifies first and last ip ordinal which identifies a range
+// in a pool of addresses
+type AddressRange struct {
+	Sub        *net.IPNet
+	Start, End uint64
+}
+
+// PoolData contains the configured pool data
+type PoolData struct {
+	ParentKey SubnetKey
+	Pool      *net.IPNet
+	Range     *AddressRange `json:",omitempty"`
+	RefCount  int
+
+	// Predefined records whether this pool was picked from the address
+	// space's configured default pools (RequestPool called with no
+	// explicit pool), as opposed to an operator-supplied CIDR.
+	Predefined bool `json:",omitempty"`
+
+	// DhcpInterface is the host interface this pool leases addresses
+	// through, set via `--ipam-opt dhcp_interface=<iface>` on the
+	// RequestPool call that created it. Empty for statically allocated
+	// pools.
+	DhcpInterface string `json:",omitempty"`
+
+	// Reserved holds the address ranges within this pool that ReserveRange
+	// has carved out as permanently unavailable to normal allocation, e.g.
+	// a gateway range or a reserved DHCP scope.
+	Reserved []reservedRange `json:",omitempty"`
+}
+
+// reservedRange is one entry of PoolData.Reserved: an inclusive [Start,
+// End] ordinal range within the pool, tagged with the caller-supplied
+// reason it was set aside.
+type reservedRange struct {
+	Start, End uint64
+	Tag        string
+}
+
+// SubPoolInfo describes one sub-pool carved out of a parent pool by a
+// RequestPool call that passed a non-empty subPool, as returned by
+// Allocator.ListSubPools.
+type SubPoolInfo struct {
+	PoolID   string
+	Pool     *net.IPNet
+	RefCount int
+}
+
+// addrSpace contains the pool configurations for the address space
+type addrSpace struct {
+	subnets map[SubnetKey]*PoolData
+	id      string
+	scope   string
+	ds      datastore.DataStore
+	alloc   *Allocator
+
+	// dhcpLeases tracks the outstanding DHCP leases handed out for
+	// pools in this address space, keyed by the leased IP.
+	dhcpLeases dhcpLeaseTable
+
+	// dbIndex/dbExists back the datastore.KVObject CAS contract: dbIndex
+	// is the store's version of the last value this object was read from
+	// or written to, and dbExists distinguishes "never written" from
+	// "index 0". writeToStore's ErrKeyModified/retry handling depends on
+	// these being real, not stubbed.
+	dbIndex  uint64
+	dbExists bool
+
+	sync.Mutex
+}
+
+// contains reports whether nw overlaps with any subnet already configured
+// in this address space.
+func (aSpace *addrSpace) contains(as string, nw *net.IPNet) bool {
+	for k, p := range aSpace.subnets {
+		if k.AddressSpace != as {
+			continue
+		}
+		if p.Range != nil {
+			continue
+		}
+		if types.NetworkOverlaps(nw, p.Pool) {
+			return true
+		}
+	}
+	return false
+}
+
+func getAddressVersion(ip net.IP) ipVersion {
+	if ip.To4() == nil {
+		return v6
+	}
+	return v4
+}
+
+// ipToUint64 converts the host part of an IP (as returned by
+// types.GetHostPartIP) into its ordinal within its subnet. It goes through
+// netip.Addr's 16-byte representation rather than big.Int-flavored math.
+func ipToUint64(ip net.IP) uint64 {
+	ip = types.GetMinimalIP(ip)
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return 0
+	}
+	return addrOrdinal(addr.Unmap())
+}
+
+// generateAddress converts an ordinal into an IP address in the passed
+// subnet. addrAddOrdinal's own math is allocation-free; the one allocation
+// left here is AsSlice's conversion back to net.IP, which is unavoidable
+// since that's the type this package's net.IPNet-based API still returns
+// (see BenchmarkGenerateAddress).
+func generateAddress(ordinal uint64, network *net.IPNet) net.IP {
+	base, ok := netip.AddrFromSlice(network.IP)
+	if !ok {
+		return nil
+	}
+	return addrAddOrdinal(base.Unmap(), ordinal).AsSlice()
+}
@@ -0,0 +1,23 @@
+package ipam
+
+import (
+	"net"
+	"testing"
+)
+
+// BenchmarkGenerateAddress measures the per-address cost of the netip-based
+// ordinal fast path on RequestAddress's success path. addrAddOrdinal works
+// entirely over netip.Addr's fixed-size array representation and allocates
+// nothing; AsSlice's conversion back to net.IP is the one allocation left,
+// since that's the type this package's net.IPNet-based API still returns.
+func BenchmarkGenerateAddress(b *testing.B) {
+	_, nw, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		b.Fatalf("ParseCIDR failed: %v", err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		generateAddress(uint64(i), nw)
+	}
+}
@@ -0,0 +1,82 @@
+// Package ipamapi specifies the contract the IPAM service (either built-in
+// or remote plugin) needs to satisfy.
+package ipamapi
+
+import (
+	"net"
+
+	"github.com/docker/libnetwork/discoverapi"
+	"github.com/docker/libnetwork/types"
+)
+
+// DefaultIPAM is the name the built-in default IPAM driver registers under
+const DefaultIPAM = "default"
+
+var (
+	// ErrIpamNotAvailable is returned when the requested ipam driver is not found
+	ErrIpamNotAvailable = types.NotFoundErrorf("ipam driver not available")
+	// ErrIPAlreadyAllocated is returned when the specified IP is already in use
+	ErrIPAlreadyAllocated = types.ForbiddenErrorf("requested IP is not available")
+	// ErrIPOutOfRange is returned when the specified IP address is not part of any pool in the requested address space
+	ErrIPOutOfRange = types.BadRequestErrorf("requested address is outside of the allowed range")
+	// ErrNoAvailableIPs is returned when there is no more IP left in the pool
+	ErrNoAvailableIPs = types.NoServiceErrorf("no available addresses on this pool")
+	// ErrInvalidAddressSpace is returned when the specified address space is not valid
+	ErrInvalidAddressSpace = types.BadRequestErrorf("invalid address space")
+	// ErrInvalidPool is returned when the specified address pool is not valid
+	ErrInvalidPool = types.BadRequestErrorf("invalid address pool")
+	// ErrInvalidSubPool is returned when the specified address sub-pool is not valid
+	ErrInvalidSubPool = types.BadRequestErrorf("invalid address pool")
+	// ErrInvalidRequest is returned when the allocation request is not valid
+	ErrInvalidRequest = types.BadRequestErrorf("invalid request")
+	// ErrPoolNotFound is returned when an address pool is not found
+	ErrPoolNotFound = types.NotFoundErrorf("address pool not found")
+)
+
+// Ipam represents the interface the IPAM service plugins must implement
+// in order to allow injection/modification of IPAM database.
+type Ipam interface {
+	discoverapi.Discover
+
+	// GetDefaultAddressSpaces returns the default local and global address space names for this ipam
+	GetDefaultAddressSpaces() (string, string, error)
+
+	// RequestPool returns an address pool along with its unique id. Address space is a mandatory field
+	// which denotes a set of non-overlapping pools. Pool is a CIDR string representing an address pool
+	// supplied by the user, when omitted the driver returns a preferred pool from its predefined range.
+	RequestPool(addressSpace, pool, subPool string, options map[string]string, v6 bool) (string, *net.IPNet, map[string]string, error)
+
+	// ReleasePool releases the address pool identified by the passed id
+	ReleasePool(poolID string) error
+
+	// RequestAddress request an address from the specified pool ID
+	RequestAddress(string, net.IP, map[string]string) (*net.IPNet, map[string]string, error)
+
+	// ReleaseAddress releases the address from the specified pool ID
+	ReleaseAddress(string, net.IP) error
+}
+
+// Capability represents the requirements a driver needs the network layer
+// to honor on its behalf when interacting with this IPAM driver.
+type Capability struct {
+	// RequiresMACAddress instructs the caller to always supply the
+	// endpoint's MAC address as an option to RequestAddress.
+	RequiresMACAddress bool
+	// RequiresRequestReplay instructs the caller to replay the original
+	// RequestPool/RequestAddress calls against this driver whenever a
+	// network is restored from local store (e.g. after a daemon
+	// restart), rather than assuming the driver persisted that state
+	// itself.
+	RequiresRequestReplay bool
+}
+
+// Registerer provides a way for network drivers to dynamically register
+// with libnetwork's IPAM subsystem so that `--ipam-driver=<name>` can pick
+// them up at network creation time.
+type Registerer interface {
+	// RegisterIpamDriver registers the ipam driver discovered by name
+	RegisterIpamDriver(name string, driver Ipam) error
+	// RegisterIpamDriverWithCapabilities registers the ipam driver discovered by name along with
+	// its capabilities.
+	RegisterIpamDriverWithCapabilities(name string, driver Ipam, capability *Capability) error
+}
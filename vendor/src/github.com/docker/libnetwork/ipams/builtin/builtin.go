@@ -0,0 +1,49 @@
+// Package builtin registers libnetwork's in-process ipam.Allocator as the
+// "default" IPAM driver.
+package builtin
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/ipam"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/types"
+)
+
+// Init registers the built-in ipam driver with r.
+func Init(r ipamapi.Registerer, lDs, gDs interface{}) error {
+	var (
+		localDs, globalDs datastore.DataStore
+		ok                bool
+	)
+
+	if lDs != nil {
+		if localDs, ok = lDs.(datastore.DataStore); !ok {
+			return types.BadRequestErrorf("incorrect local datastore passed to built-in ipam init")
+		}
+	}
+
+	if gDs != nil {
+		if globalDs, ok = gDs.(datastore.DataStore); !ok {
+			return types.BadRequestErrorf("incorrect global datastore passed to built-in ipam init")
+		}
+	}
+
+	a, err := ipam.NewAllocator(localDs, globalDs)
+	if err != nil {
+		return err
+	}
+
+	// RequiresMACAddress: the built-in driver's DHCP path (dhcp.go's
+	// dhcpNegotiate) needs the endpoint MAC to build its DHCP packets, so
+	// callers must keep passing it through to RequestAddress regardless of
+	// whether any given pool in this process actually uses DHCP.
+	cps := &ipamapi.Capability{RequiresMACAddress: true, RequiresRequestReplay: false}
+
+	if err := r.RegisterIpamDriverWithCapabilities(ipamapi.DefaultIPAM, a, cps); err != nil {
+		log.Warnf("failed to register the %s ipam driver: %v", ipamapi.DefaultIPAM, err)
+		return err
+	}
+
+	return nil
+}
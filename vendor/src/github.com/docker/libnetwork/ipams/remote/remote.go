@@ -0,0 +1,229 @@
+// Package remote provides the client side of a remote/plugin IPAM driver:
+// it speaks libnetwork's plugin protocol (JSON bodies over an HTTP
+// connection to the plugin's Unix socket) and exposes the result as an
+// ipamapi.Ipam implementation.
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/discoverapi"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/types"
+)
+
+const (
+	prefix                   = "IpamDriver"
+	defaultAddressSpacesPath = prefix + ".GetDefaultAddressSpaces"
+	requestPoolPath          = prefix + ".RequestPool"
+	releasePoolPath          = prefix + ".ReleasePool"
+	requestAddressPath       = prefix + ".RequestAddress"
+	releaseAddressPath       = prefix + ".ReleaseAddress"
+	capabilitiesPath         = prefix + ".GetCapabilities"
+)
+
+// client is the minimal transport the remote driver needs: a plugin call
+// that posts a JSON request body and decodes a JSON response body.
+type client interface {
+	Call(serviceMethod string, args interface{}, ret interface{}) error
+}
+
+// Init makes the remote ipam driver available by registering it under name
+// with r, using c to talk to the actual plugin process.
+func Init(r ipamapi.Registerer, name string, c client) error {
+	d := newAllocator(name, c)
+
+	caps, err := d.getCapabilities()
+	if err != nil {
+		log.Warnf("ipam driver %s did not return capabilities: %v", name, err)
+		return r.RegisterIpamDriver(name, d)
+	}
+
+	return r.RegisterIpamDriverWithCapabilities(name, d, caps)
+}
+
+type allocator struct {
+	name     string
+	endpoint client
+}
+
+func newAllocator(name string, c client) *allocator {
+	return &allocator{name: name, endpoint: c}
+}
+
+type capabilitiesResponse struct {
+	RequiresMACAddress    bool
+	RequiresRequestReplay bool
+}
+
+func (a *allocator) getCapabilities() (*ipamapi.Capability, error) {
+	var res capabilitiesResponse
+	if err := a.call(capabilitiesPath, nil, &res); err != nil {
+		return nil, err
+	}
+	return &ipamapi.Capability{
+		RequiresMACAddress:    res.RequiresMACAddress,
+		RequiresRequestReplay: res.RequiresRequestReplay,
+	}, nil
+}
+
+type addressSpacesResponse struct {
+	LocalDefaultAddressSpace  string
+	GlobalDefaultAddressSpace string
+}
+
+func (a *allocator) GetDefaultAddressSpaces() (string, string, error) {
+	var res addressSpacesResponse
+	if err := a.call(defaultAddressSpacesPath, nil, &res); err != nil {
+		return "", "", err
+	}
+	return res.LocalDefaultAddressSpace, res.GlobalDefaultAddressSpace, nil
+}
+
+type requestPoolRequest struct {
+	AddressSpace string
+	Pool         string
+	SubPool      string
+	Options      map[string]string
+	V6           bool
+}
+
+type requestPoolResponse struct {
+	PoolID string
+	Pool   string
+	Data   map[string]string
+}
+
+func (a *allocator) RequestPool(addressSpace, pool, subPool string, options map[string]string, v6 bool) (string, *net.IPNet, map[string]string, error) {
+	req := &requestPoolRequest{
+		AddressSpace: addressSpace,
+		Pool:         pool,
+		SubPool:      subPool,
+		Options:      options,
+		V6:           v6,
+	}
+	var res requestPoolResponse
+	if err := a.call(requestPoolPath, req, &res); err != nil {
+		return "", nil, nil, err
+	}
+
+	retPool, err := types.ParseCIDR(res.Pool)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	return res.PoolID, retPool, res.Data, nil
+}
+
+type releasePoolRequest struct {
+	PoolID string
+}
+
+func (a *allocator) ReleasePool(poolID string) error {
+	req := &releasePoolRequest{PoolID: poolID}
+	return a.call(releasePoolPath, req, &struct{}{})
+}
+
+type requestAddressRequest struct {
+	PoolID  string
+	Address string
+	Options map[string]string
+}
+
+type requestAddressResponse struct {
+	Address string
+	Data    map[string]string
+}
+
+func (a *allocator) RequestAddress(poolID string, address net.IP, options map[string]string) (*net.IPNet, map[string]string, error) {
+	req := &requestAddressRequest{PoolID: poolID, Options: options}
+	if address != nil {
+		req.Address = address.String()
+	}
+
+	var res requestAddressResponse
+	if err := a.call(requestAddressPath, req, &res); err != nil {
+		return nil, nil, err
+	}
+
+	retAddress, err := types.ParseCIDR(res.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return retAddress, res.Data, nil
+}
+
+type releaseAddressRequest struct {
+	PoolID  string
+	Address string
+}
+
+func (a *allocator) ReleaseAddress(poolID string, address net.IP) error {
+	req := &releaseAddressRequest{PoolID: poolID}
+	if address != nil {
+		req.Address = address.String()
+	}
+	return a.call(releaseAddressPath, req, &struct{}{})
+}
+
+// DiscoverNew is not implemented for the remote ipam driver.
+func (a *allocator) DiscoverNew(dType discoverapi.DiscoveryType, data interface{}) error {
+	return nil
+}
+
+// DiscoverDelete is not implemented for the remote ipam driver.
+func (a *allocator) DiscoverDelete(dType discoverapi.DiscoveryType, data interface{}) error {
+	return nil
+}
+
+// call marshals req as JSON, posts it to a.name's plugin endpoint at path
+// via a.endpoint, and unmarshals the JSON response into res.
+func (a *allocator) call(path string, req interface{}, res interface{}) error {
+	if err := a.endpoint.Call(path, req, res); err != nil {
+		return fmt.Errorf("error calling %s ipam plugin %s: %v", a.name, path, err)
+	}
+	return nil
+}
+
+// httpClient is the default client implementation: it posts JSON bodies
+// over HTTP to a plugin listening on base (typically a Unix socket address
+// wrapped in an *http.Client with a custom Transport.Dial).
+type httpClient struct {
+	base string
+	http *http.Client
+}
+
+// NewHTTPClient returns a client that posts JSON requests to base using hc.
+func NewHTTPClient(base string, hc *http.Client) client {
+	return &httpClient{base: base, http: hc}
+}
+
+func (c *httpClient) Call(serviceMethod string, args interface{}, ret interface{}) error {
+	var body bytes.Buffer
+	if args != nil {
+		if err := json.NewEncoder(&body).Encode(args); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.http.Post(c.base+"/"+serviceMethod, "application/vnd.docker.plugins.v1+json", &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("remote: %s returned status %d", serviceMethod, resp.StatusCode)
+	}
+
+	if ret == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(ret)
+}
@@ -0,0 +1,98 @@
+// Package ipamutils provides utility functions for ipam management
+package ipamutils
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// NetworkToSplit represents a base CIDR that the default IPAM driver
+// should carve into same-sized, non-overlapping sub-networks on demand,
+// rather than materialize up front. Size is the prefix length (in bits)
+// of each sub-network handed out of Base.
+type NetworkToSplit struct {
+	Base *net.IPNet
+	Size int
+}
+
+var (
+	// PredefinedBroadNetworks is used by the LocalDefault address space:
+	// a handful of host-local bridge-sized ranges.
+	PredefinedBroadNetworks []*NetworkToSplit
+	// PredefinedGranularNetworks is used by the GlobalDefault address
+	// space: many small, swarm-wide overlay network ranges.
+	PredefinedGranularNetworks []*NetworkToSplit
+)
+
+func init() {
+	PredefinedBroadNetworks = defaultBroadNetworks()
+	PredefinedGranularNetworks = defaultGranularNetworks()
+}
+
+func defaultBroadNetworks() []*NetworkToSplit {
+	return []*NetworkToSplit{
+		{Base: mustParseCIDR("172.17.0.0/16"), Size: 24},
+		{Base: mustParseCIDR("172.18.0.0/16"), Size: 24},
+		{Base: mustParseCIDR("172.19.0.0/16"), Size: 24},
+		{Base: mustParseCIDR("172.20.0.0/14"), Size: 24},
+		{Base: mustParseCIDR("172.24.0.0/14"), Size: 24},
+		{Base: mustParseCIDR("172.28.0.0/14"), Size: 24},
+		{Base: mustParseCIDR("192.168.0.0/16"), Size: 20},
+	}
+}
+
+func defaultGranularNetworks() []*NetworkToSplit {
+	return []*NetworkToSplit{
+		{Base: mustParseCIDR("10.0.0.0/8"), Size: 24},
+	}
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// InitNetworks overrides the compiled-in default pool lists that a new
+// Allocator seeds itself from. Either argument may be passed nil to leave
+// that scope's list at its built-in default. It has no effect on
+// Allocators that already exist, see Allocator.ConfigureDefaultAddressPool
+// for reconfiguring those.
+func InitNetworks(local, global []*NetworkToSplit) {
+	if local != nil {
+		PredefinedBroadNetworks = local
+	}
+	if global != nil {
+		PredefinedGranularNetworks = global
+	}
+}
+
+// SplitNetwork returns the i'th sub-network of n.Size bits carved out of
+// n.Base, and true if i is in range. Sub-networks are numbered in address
+// order starting at 0. Only IPv4 bases are supported.
+func SplitNetwork(n *NetworkToSplit, i int) (*net.IPNet, bool) {
+	base4 := n.Base.IP.To4()
+	if base4 == nil {
+		return nil, false
+	}
+
+	baseOnes, bits := n.Base.Mask.Size()
+	if bits != 32 || n.Size < baseOnes || n.Size > 32 {
+		return nil, false
+	}
+
+	count := 1 << uint(n.Size-baseOnes)
+	if i < 0 || i >= count {
+		return nil, false
+	}
+
+	baseInt := binary.BigEndian.Uint32(base4)
+	subnetInt := baseInt | (uint32(i) << uint(32-n.Size))
+
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, subnetInt)
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(n.Size, 32)}, true
+}